@@ -0,0 +1,28 @@
+package mhash
+
+// ShouldSplit reports whether bucket has grown past Options.MaxBucketItems and,
+// with Options.AdaptiveSplit enabled, should be split into a child trie level
+// instead of growing further in place.
+func (u *HashUpdater[T, R, K]) ShouldSplit(bucket Bucket[T]) bool {
+	if !u.options.AdaptiveSplit || u.options.MaxBucketItems <= 0 {
+		return false
+	}
+	return len(bucket.Items) > u.options.MaxBucketItems
+}
+
+// IsSparse reports whether the sibling buckets under parent are sparse enough
+// to be merged back into parent by a background compaction pass:
+// siblingItemCounts holds the item count of each child bucket, and their
+// combined total must be at most MaxBucketItems for compaction to be
+// worthwhile.
+func (u *HashUpdater[T, R, K]) IsSparse(siblingItemCounts []int) bool {
+	if !u.options.AdaptiveSplit || u.options.MaxBucketItems <= 0 {
+		return false
+	}
+
+	total := 0
+	for _, count := range siblingItemCounts {
+		total += count
+	}
+	return total <= u.options.MaxBucketItems
+}
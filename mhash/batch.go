@@ -0,0 +1,123 @@
+package mhash
+
+import (
+	"context"
+	"errors"
+
+	"github.com/QuangTung97/memproxy/item"
+)
+
+// coalesceBucketKeys returns the distinct BucketKeys that still need fetching
+// for the not-yet-done keys at their current hashLens, in key order, so that
+// keys whose current level maps to the same bucket (e.g. siblings sharing a
+// parent, or simply not having descended yet) issue only one fetch between
+// them instead of one per key.
+func coalesceBucketKeys[R item.Key](
+	rootKey R, keyHashes []uint64, hashLens []int, done []bool, bitsPerLevel int,
+) []BucketKey[R] {
+	seen := map[BucketKey[R]]bool{}
+	keys := make([]BucketKey[R], 0, len(keyHashes))
+	for i := range keyHashes {
+		if done[i] {
+			continue
+		}
+		bucketKey := BucketKey[R]{
+			RootKey: rootKey,
+			Hash:    computeHashAtLevel(keyHashes[i], hashLens[i], bitsPerLevel),
+			HashLen: hashLens[i],
+		}
+		if seen[bucketKey] {
+			continue
+		}
+		seen[bucketKey] = true
+		keys = append(keys, bucketKey)
+	}
+	return keys
+}
+
+// GetMulti fetches multiple keys under the same rootKey in a single batched
+// pipeline. All root-level bucket fetches are issued together, then each key
+// descends independently as its bitsets indicate splits, reusing
+// Session.AddNextCall the same way Get does rather than spawning goroutines.
+// Bucket fetches shared by more than one key at the same level are coalesced
+// so a shared parent bucket is only loaded once.
+//
+// A key that goes deeper than Options.MaxDepth resolves to a zero Null[T]
+// (Valid: false) instead of failing the whole batch, the same way a missing
+// key does; callers that must tell "too deep" apart from "absent" should use
+// Get for that key instead of GetMulti. Any other error still fails the call.
+func (h *Hash[T, R, K]) GetMulti(ctx context.Context, rootKey R, keys []K) func() ([]Null[T], error) {
+	keyHashes := make([]uint64, len(keys))
+	for i, k := range keys {
+		keyHashes[i] = k.Hash()
+	}
+
+	results := make([]getResult[T], len(keys))
+	hashLens := make([]int, len(keys))
+	done := make([]bool, len(keys))
+
+	var stepFn func()
+	bucketFns := map[BucketKey[R]]func() (Bucket[T], error){}
+
+	doFetchFn := func() {
+		bucketFns = map[BucketKey[R]]func() (Bucket[T], error){}
+		for _, bucketKey := range coalesceBucketKeys(rootKey, keyHashes, hashLens, done, h.options.BitsPerLevel) {
+			bucketFns[bucketKey] = h.bucketItem.Get(ctx, bucketKey)
+		}
+		h.sess.AddNextCall(stepFn)
+	}
+
+	stepFn = func() {
+		needsNextLevel := false
+
+		for i := range keys {
+			if done[i] {
+				continue
+			}
+
+			bucketKey := BucketKey[R]{
+				RootKey: rootKey,
+				Hash:    computeHashAtLevel(keyHashes[i], hashLens[i], h.options.BitsPerLevel),
+				HashLen: hashLens[i],
+			}
+
+			bucket, err := bucketFns[bucketKey]()
+			if err != nil {
+				results[i].err = err
+				done[i] = true
+				continue
+			}
+
+			step := lookupInBucket(bucket, h.getKey, keys[i], keyHashes[i], hashLens[i], h.options)
+			if step.descend {
+				hashLens[i]++
+				needsNextLevel = true
+				continue
+			}
+			results[i].resp, results[i].err = step.resp, step.err
+			done[i] = true
+		}
+
+		if needsNextLevel {
+			doFetchFn()
+		}
+	}
+
+	doFetchFn()
+
+	return func() ([]Null[T], error) {
+		h.sess.Execute()
+
+		resp := make([]Null[T], len(keys))
+		for i, r := range results {
+			if r.err != nil {
+				if errors.Is(r.err, ErrHashTooDeep) {
+					continue
+				}
+				return nil, r.err
+			}
+			resp[i] = r.resp
+		}
+		return resp, nil
+	}
+}
@@ -0,0 +1,49 @@
+package mhash
+
+import "testing"
+
+// TestCoalesceBucketKeys checks the dedup GetMulti relies on to avoid issuing
+// duplicate fetches for keys that share a bucket at their current level, and
+// that keys already marked done are excluded entirely.
+func TestCoalesceBucketKeys(t *testing.T) {
+	const bitsPerLevel = 8
+
+	hashA := uint64(1) << 56
+	hashB := uint64(1) << 56 // same top byte as A: shares A's bucket at hashLen 1
+	hashC := uint64(3) << 56 // distinct bucket at hashLen 1
+
+	keyHashes := []uint64{hashA, hashB, hashC}
+	hashLens := []int{1, 1, 1}
+	done := []bool{false, false, false}
+
+	keys := coalesceBucketKeys[updaterTestRootKey]("root", keyHashes, hashLens, done, bitsPerLevel)
+
+	want := []BucketKey[updaterTestRootKey]{
+		{RootKey: "root", Hash: hashA, HashLen: 1},
+		{RootKey: "root", Hash: hashC, HashLen: 1},
+	}
+	if len(keys) != len(want) {
+		t.Fatalf("coalesceBucketKeys = %+v, want %+v", keys, want)
+	}
+	for i := range want {
+		if keys[i] != want[i] {
+			t.Errorf("coalesceBucketKeys[%d] = %+v, want %+v", i, keys[i], want[i])
+		}
+	}
+
+	// Marking the key that shares A's bucket as done must not leave a
+	// duplicate-free but otherwise-empty bucket key behind; A's bucket should
+	// still be fetched once for the remaining key sharing it.
+	done = []bool{false, true, false}
+	keys = coalesceBucketKeys[updaterTestRootKey]("root", keyHashes, hashLens, done, bitsPerLevel)
+	if len(keys) != 2 {
+		t.Fatalf("coalesceBucketKeys(with done) = %+v, want 2 entries", keys)
+	}
+
+	// Every key done: nothing left to fetch.
+	done = []bool{true, true, true}
+	keys = coalesceBucketKeys[updaterTestRootKey]("root", keyHashes, hashLens, done, bitsPerLevel)
+	if len(keys) != 0 {
+		t.Errorf("coalesceBucketKeys(all done) = %+v, want empty", keys)
+	}
+}
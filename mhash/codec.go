@@ -0,0 +1,43 @@
+package mhash
+
+import "github.com/QuangTung97/memproxy/item"
+
+// BucketCodec controls how a Bucket[T] is encoded to and decoded from the bytes
+// stored behind a BucketKey, letting callers swap the on-wire format used by
+// Hash and HashUpdater.
+type BucketCodec[T item.Value] interface {
+	// MarshalBucket encodes bucket to its on-wire representation.
+	MarshalBucket(bucket Bucket[T]) ([]byte, error)
+	// UnmarshalBucket decodes a Bucket[T] previously produced by MarshalBucket.
+	UnmarshalBucket(data []byte) (Bucket[T], error)
+	// CodecName identifies the codec, so metrics can label encoding choice.
+	CodecName() string
+}
+
+// itemBucketCodec is the default BucketCodec, built on top of the item package's
+// Unmarshaler for T, matching the encoding used before BucketCodec was introduced.
+type itemBucketCodec[T item.Value] struct {
+	unmarshal func([]byte) (Bucket[T], error)
+}
+
+// newItemBucketCodec builds the default BucketCodec from an item.Unmarshaler[T].
+func newItemBucketCodec[T item.Value](unmarshaler item.Unmarshaler[T]) BucketCodec[T] {
+	return itemBucketCodec[T]{
+		unmarshal: BucketUnmarshalerFromItem(unmarshaler),
+	}
+}
+
+// MarshalBucket encodes bucket using the same layout as the Snapshot subsystem.
+func (c itemBucketCodec[T]) MarshalBucket(bucket Bucket[T]) ([]byte, error) {
+	return marshalSnapshotBucket(bucket)
+}
+
+// UnmarshalBucket decodes bucket data previously produced by MarshalBucket.
+func (c itemBucketCodec[T]) UnmarshalBucket(data []byte) (Bucket[T], error) {
+	return c.unmarshal(data)
+}
+
+// CodecName returns "item".
+func (c itemBucketCodec[T]) CodecName() string {
+	return "item"
+}
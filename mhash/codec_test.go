@@ -0,0 +1,74 @@
+package mhash
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type codecTestItem struct {
+	Key  string
+	Data string
+}
+
+func (v codecTestItem) Marshal() ([]byte, error) {
+	return []byte(v.Key + "|" + v.Data), nil
+}
+
+func unmarshalCodecTestItem(data []byte) (codecTestItem, error) {
+	key, rest, found := strings.Cut(string(data), "|")
+	if !found {
+		return codecTestItem{}, errors.New("mhash: missing separator in test item")
+	}
+	return codecTestItem{Key: key, Data: rest}, nil
+}
+
+func newCodecTestBucket() Bucket[codecTestItem] {
+	bucket := Bucket[codecTestItem]{
+		Items: []codecTestItem{
+			{Key: "a", Data: "1"},
+			{Key: "b", Data: "2"},
+		},
+		Bitset: newBitSet(256),
+	}
+	bucket.Bitset.SetBit(5)
+	bucket.Bitset.SetBit(200)
+	return bucket
+}
+
+// TestBucketCodecs_RoundTrip checks that every BucketCodec implementation
+// decodes exactly what it encoded, since Hash and HashUpdater both rely on
+// MarshalBucket/UnmarshalBucket round-tripping for whichever codec is chosen.
+func TestBucketCodecs_RoundTrip(t *testing.T) {
+	codecs := []BucketCodec[codecTestItem]{
+		newItemBucketCodec[codecTestItem](unmarshalCodecTestItem),
+		NewRLPBucketCodec[codecTestItem](unmarshalCodecTestItem),
+		NewMsgpackBucketCodec[codecTestItem](unmarshalCodecTestItem),
+	}
+
+	for _, codec := range codecs {
+		codec := codec
+		t.Run(codec.CodecName(), func(t *testing.T) {
+			original := newCodecTestBucket()
+
+			data, err := codec.MarshalBucket(original)
+			if err != nil {
+				t.Fatalf("MarshalBucket: %v", err)
+			}
+
+			decoded, err := codec.UnmarshalBucket(data)
+			if err != nil {
+				t.Fatalf("UnmarshalBucket: %v", err)
+			}
+
+			if !reflect.DeepEqual(original.Items, decoded.Items) {
+				t.Errorf("items mismatch: got %+v, want %+v", decoded.Items, original.Items)
+			}
+			if !bytes.Equal(original.Bitset, decoded.Bitset) {
+				t.Errorf("bitset mismatch: got %x, want %x", decoded.Bitset, original.Bitset)
+			}
+		})
+	}
+}
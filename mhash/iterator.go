@@ -0,0 +1,219 @@
+package mhash
+
+import (
+	"context"
+	"math"
+
+	"github.com/QuangTung97/memproxy/item"
+)
+
+// IterateOptions configures the hash range scanned by Hash.Iterate.
+type IterateOptions struct {
+	// StartHash is the inclusive lower bound of the hash range to scan.
+	StartHash uint64
+	// EndHash is the exclusive upper bound of the hash range to scan. Zero means
+	// scan up to the maximum hash value.
+	EndHash uint64
+}
+
+// Iterator walks the items of a mhash trie level by level: every bucket of one
+// level (in ascending bucket hash) before any bucket of the next, and the items
+// of a bucket in the order they are stored. Items are not sorted by hash.
+type Iterator[T any] interface {
+	// Seek advances the iterator so that the next call to Next returns the first
+	// remaining item with hash >= hash.
+	Seek(hash uint64)
+
+	// Next returns the next item in walk order, or ok=false once the scanned
+	// range is exhausted or an error occurred (see Err).
+	Next() (val T, ok bool)
+
+	// Err returns the first error encountered while walking the trie, if any.
+	Err() error
+
+	// Skip abandons the bucket currently being visited, without fetching or
+	// descending into any of its child buckets.
+	Skip()
+}
+
+// readyBucket is a bucket that has been fetched and is waiting to be walked.
+type readyBucket[T item.Value, R item.Key] struct {
+	key    BucketKey[R]
+	bucket Bucket[T]
+}
+
+// hashIterator is the Iterator implementation returned by Hash.Iterate.
+type hashIterator[T item.Value, R item.Key, K Key] struct {
+	h       *Hash[T, R, K]
+	ctx     context.Context
+	rootKey R
+
+	startHash uint64
+	endHash   uint64
+
+	err error
+
+	// frontier holds bucket keys not yet fetched, all belonging to the same level.
+	frontier []BucketKey[R]
+	// ready holds fetched buckets awaiting traversal, in frontier order.
+	ready []readyBucket[T, R]
+
+	curKey    BucketKey[R]
+	curBucket Bucket[T]
+	haveCur   bool
+	skipCur   bool
+
+	items    []T
+	itemsPos int
+}
+
+// Iterate walks every item under rootKey whose hash falls inside
+// [opts.StartHash, opts.EndHash), descending into child buckets only where the
+// parent's Bitset indicates a split, and batches bucket fetches per trie level
+// through the Hash's Session.
+func (h *Hash[T, R, K]) Iterate(ctx context.Context, rootKey R, opts IterateOptions) Iterator[T] {
+	endHash := opts.EndHash
+	if endHash == 0 {
+		endHash = math.MaxUint64
+	}
+
+	return &hashIterator[T, R, K]{
+		h:         h,
+		ctx:       ctx,
+		rootKey:   rootKey,
+		startHash: opts.StartHash,
+		endHash:   endHash,
+		frontier: []BucketKey[R]{
+			{RootKey: rootKey, Hash: 0, HashLen: 0},
+		},
+	}
+}
+
+// RangeByHash is a convenience wrapper around Iterate for scanning
+// [startHash, endHash) without constructing an IterateOptions value.
+func (h *Hash[T, R, K]) RangeByHash(
+	ctx context.Context, rootKey R, startHash, endHash uint64,
+) Iterator[T] {
+	return h.Iterate(ctx, rootKey, IterateOptions{
+		StartHash: startHash,
+		EndHash:   endHash,
+	})
+}
+
+// Seek advances the lower bound of the scanned range. Items already buffered from
+// the current bucket that fall below hash are skipped on the next call to Next.
+func (it *hashIterator[T, R, K]) Seek(hash uint64) {
+	it.startHash = hash
+}
+
+// Err returns the first error encountered while walking the trie, if any.
+func (it *hashIterator[T, R, K]) Err() error {
+	return it.err
+}
+
+// Skip abandons the bucket currently being visited without loading its children.
+func (it *hashIterator[T, R, K]) Skip() {
+	it.itemsPos = len(it.items)
+	it.skipCur = true
+}
+
+// Next returns the next item in walk order. Once it.err is set (by
+// enqueueChildren or fetchFrontier), Next keeps draining items already
+// buffered in it.items and buckets already fetched into it.ready before it
+// starts returning false, so a failure in one subtree (e.g. ErrHashTooDeep)
+// does not discard items from sibling buckets that were already fetched.
+func (it *hashIterator[T, R, K]) Next() (val T, ok bool) {
+	for {
+		if it.haveCur {
+			for it.itemsPos < len(it.items) {
+				v := it.items[it.itemsPos]
+				it.itemsPos++
+
+				hash := it.h.getKey(v).Hash()
+				if hash < it.startHash || hash >= it.endHash {
+					continue
+				}
+				return v, true
+			}
+
+			if !it.skipCur && it.err == nil {
+				it.enqueueChildren()
+			}
+			it.haveCur = false
+			it.skipCur = false
+		}
+
+		if len(it.ready) > 0 {
+			next := it.ready[0]
+			it.ready = it.ready[1:]
+
+			it.curKey = next.key
+			it.curBucket = next.bucket
+			it.items = next.bucket.Items
+			it.itemsPos = 0
+			it.haveCur = true
+			continue
+		}
+
+		if it.err != nil {
+			return val, false
+		}
+
+		if len(it.frontier) == 0 {
+			return val, false
+		}
+		if err := it.fetchFrontier(); err != nil {
+			it.err = err
+		}
+	}
+}
+
+// fetchFrontier batches a bucketItem.Get call for every key in the current
+// frontier through the shared Session, executing them in a single pipelined pass.
+func (it *hashIterator[T, R, K]) fetchFrontier() error {
+	keys := it.frontier
+	it.frontier = nil
+
+	fns := make([]func() (Bucket[T], error), len(keys))
+	for i, key := range keys {
+		fns[i] = it.h.bucketItem.Get(it.ctx, key)
+	}
+	it.h.sess.Execute()
+
+	for i, fn := range fns {
+		bucket, err := fn()
+		if err != nil {
+			return err
+		}
+		it.ready = append(it.ready, readyBucket[T, R]{key: keys[i], bucket: bucket})
+	}
+	return nil
+}
+
+// enqueueChildren adds the child buckets indicated by the current bucket's
+// Bitset to the frontier, setting it.err to ErrHashTooDeep instead of
+// descending past Options.MaxDepth.
+func (it *hashIterator[T, R, K]) enqueueChildren() {
+	childHashLen := it.curKey.HashLen + 1
+	bitsPerLevel := it.h.options.BitsPerLevel
+	numBits := len(it.curBucket.Bitset) << bitSetShift
+
+	for bit := 0; bit < numBits; bit++ {
+		if !it.curBucket.Bitset.GetBit(bit) {
+			continue
+		}
+
+		if childHashLen >= it.h.options.MaxDepth {
+			it.err = ErrHashTooDeep
+			return
+		}
+
+		shift := 64 - bitsPerLevel - it.curKey.HashLen*bitsPerLevel
+		childHash := it.curKey.Hash | (uint64(bit) << shift)
+		it.frontier = append(it.frontier, BucketKey[R]{
+			RootKey: it.rootKey,
+			Hash:    childHash,
+			HashLen: childHashLen,
+		})
+	}
+}
@@ -0,0 +1,103 @@
+package mhash
+
+import "testing"
+
+// newTestHashForIterator builds a Hash with just enough set (getKey, options)
+// to drive hashIterator directly. It deliberately leaves bucketItem/sess/
+// snapshot at their zero values: every test below pre-populates it.ready so
+// fetchFrontier (the only place those are touched) is never reached.
+func newTestHashForIterator(options Options) *Hash[updaterTestItem, updaterTestRootKey, updaterTestKey] {
+	return &Hash[updaterTestItem, updaterTestRootKey, updaterTestKey]{
+		getKey:  func(v updaterTestItem) updaterTestKey { return v.K },
+		options: options.withDefaults(),
+	}
+}
+
+// TestHashIterator_DrainsBufferedItemsBeforeSurfacingError pins the fix from
+// the chunk0-2 request: one bucket hitting MaxDepth must not discard items
+// from a sibling bucket that was already fetched into it.ready.
+func TestHashIterator_DrainsBufferedItemsBeforeSurfacingError(t *testing.T) {
+	h := newTestHashForIterator(Options{BitsPerLevel: 8, MaxDepth: 1})
+
+	// bucketA's Bitset points one level deeper, but MaxDepth=1 means
+	// enqueueChildren must refuse to descend and set it.err instead of
+	// silently dropping everything still buffered.
+	bucketA := Bucket[updaterTestItem]{
+		Items:  []updaterTestItem{{K: 1, Data: "a"}},
+		Bitset: newBitSet(h.options.numBitsetEntries()),
+	}
+	bucketA.Bitset.SetBit(5)
+
+	// bucketB is a sibling already fetched into the same batch, with nothing
+	// left to descend into.
+	bucketB := Bucket[updaterTestItem]{
+		Items: []updaterTestItem{{K: 2, Data: "b"}},
+	}
+
+	it := &hashIterator[updaterTestItem, updaterTestRootKey, updaterTestKey]{
+		h:       h,
+		endHash: ^uint64(0),
+		ready: []readyBucket[updaterTestItem, updaterTestRootKey]{
+			{key: BucketKey[updaterTestRootKey]{RootKey: "root", Hash: 0, HashLen: 0}, bucket: bucketA},
+			{key: BucketKey[updaterTestRootKey]{RootKey: "root", Hash: 1 << 56, HashLen: 0}, bucket: bucketB},
+		},
+	}
+
+	var got []updaterTestItem
+	for {
+		v, ok := it.Next()
+		if !ok {
+			break
+		}
+		got = append(got, v)
+	}
+
+	if len(got) != 2 || got[0].K != 1 || got[1].K != 2 {
+		t.Fatalf("Next() drained %+v, want items from both buckets before the error surfaces", got)
+	}
+	if it.Err() != ErrHashTooDeep {
+		t.Errorf("Err() = %v, want ErrHashTooDeep", it.Err())
+	}
+
+	if _, ok := it.Next(); ok {
+		t.Errorf("Next() after drain+error = ok:true, want false")
+	}
+}
+
+// TestHashIterator_Skip checks that Skip stops enqueueChildren from running
+// for the current bucket, instead of descending into it on the next Next().
+func TestHashIterator_Skip(t *testing.T) {
+	h := newTestHashForIterator(Options{BitsPerLevel: 8, MaxDepth: 5})
+
+	bucket := Bucket[updaterTestItem]{
+		Items:  []updaterTestItem{{K: 1, Data: "a"}},
+		Bitset: newBitSet(h.options.numBitsetEntries()),
+	}
+	bucket.Bitset.SetBit(5) // would normally require descending a level
+
+	it := &hashIterator[updaterTestItem, updaterTestRootKey, updaterTestKey]{
+		h:       h,
+		endHash: ^uint64(0),
+		ready: []readyBucket[updaterTestItem, updaterTestRootKey]{
+			{key: BucketKey[updaterTestRootKey]{RootKey: "root", Hash: 0, HashLen: 0}, bucket: bucket},
+		},
+	}
+
+	v, ok := it.Next()
+	if !ok || v.K != 1 {
+		t.Fatalf("Next() = %+v, %v, want the bucket's one item", v, ok)
+	}
+	it.Skip()
+
+	// If Skip failed to suppress enqueueChildren, the next Next() would try
+	// to fetch the frontier through h.bucketItem, which is nil in this test.
+	if _, ok := it.Next(); ok {
+		t.Errorf("Next() after Skip = ok:true, want false (nothing left)")
+	}
+	if it.Err() != nil {
+		t.Errorf("Err() = %v, want nil", it.Err())
+	}
+	if len(it.frontier) != 0 {
+		t.Errorf("frontier = %+v, want empty: Skip should have prevented enqueueChildren", it.frontier)
+	}
+}
@@ -13,7 +13,50 @@ import (
 // ErrHashTooDeep when too many levels to go to
 var ErrHashTooDeep = errors.New("mhash: hash go too deep")
 
-const maxDeepLevels = 5
+const defaultMaxDepth = 5
+const defaultBitsPerLevel = 8
+
+// Options configures the trie depth and fanout used by a Hash or HashUpdater.
+type Options struct {
+	// MaxDepth is the maximum number of trie levels to descend before Get
+	// returns ErrHashTooDeep instead of splitting further. Defaults to 5.
+	MaxDepth int
+	// BitsPerLevel is the number of hash bits consumed at each trie level; it
+	// must divide 64. Defaults to 8, which keeps the original 256-entry bitset
+	// per level.
+	BitsPerLevel int
+	// MaxBucketItems is the item count past which AdaptiveSplit mode splits a
+	// bucket into a child level instead of growing it further in place.
+	MaxBucketItems int
+	// AdaptiveSplit makes HashUpdater.Set split a bucket once it holds more
+	// than MaxBucketItems items (without it, Set never splits), and enables
+	// background compaction of sparse sibling buckets back up a level.
+	AdaptiveSplit bool
+}
+
+func (o Options) withDefaults() Options {
+	if o.MaxDepth <= 0 {
+		o.MaxDepth = defaultMaxDepth
+	}
+	if o.BitsPerLevel <= 0 {
+		o.BitsPerLevel = defaultBitsPerLevel
+	}
+	// A level consumes BitsPerLevel bits out of the 64-bit hash, so descending
+	// MaxDepth levels must never need more than 64 bits; computeBitOffsetAtNextLevel
+	// would otherwise be asked for a negative shift count. Clamp rather than
+	// reject, since MaxDepth is just the point Get gives up and returns
+	// ErrHashTooDeep.
+	if maxLevels := 64 / o.BitsPerLevel; o.MaxDepth > maxLevels {
+		o.MaxDepth = maxLevels
+	}
+	return o
+}
+
+// numBitsetEntries returns how many bits a BitSet needs to cover every child at
+// a single trie level under these Options.
+func (o Options) numBitsetEntries() int {
+	return 1 << o.BitsPerLevel
+}
 
 // Null ...
 type Null[T any] struct {
@@ -23,10 +66,31 @@ type Null[T any] struct {
 
 const bitSetShift = 3
 const bitSetMask = 1<<bitSetShift - 1
-const bitSetBytes = 256 / (1 << bitSetShift)
 
-// BitSet ...
-type BitSet [bitSetBytes]byte
+// BitSet is a variable-width bitset with one bit per possible child at a trie
+// level; its length depends on Options.BitsPerLevel, so it is a slice rather
+// than the fixed 256-entry array used before Options was introduced.
+type BitSet []byte
+
+// newBitSet allocates a BitSet large enough to hold numEntries bits.
+func newBitSet(numEntries int) BitSet {
+	return make(BitSet, numEntries>>bitSetShift)
+}
+
+// GetBit reports whether bit offset is set.
+func (b BitSet) GetBit(offset int) bool {
+	idx := offset >> bitSetShift
+	if idx < 0 || idx >= len(b) {
+		return false
+	}
+	return b[idx]&(1<<(offset&bitSetMask)) != 0
+}
+
+// SetBit sets bit offset.
+func (b BitSet) SetBit(offset int) {
+	idx := offset >> bitSetShift
+	b[idx] |= 1 << (offset & bitSetMask)
+}
 
 // Bucket ...
 type Bucket[T item.Value] struct {
@@ -51,6 +115,10 @@ func (k BucketKey[R]) String() string {
 // Filler ...
 type Filler[T any, R any] func(ctx context.Context, rootKey R, hash uint64) func() ([]byte, error)
 
+// Setter writes encoded bucket data back to the backing store for rootKey at a
+// given hash level, mirroring Filler for writes.
+type Setter[R any] func(ctx context.Context, rootKey R, hash uint64, data []byte) func() error
+
 // Key types
 type Key interface {
 	comparable
@@ -59,18 +127,54 @@ type Key interface {
 
 // Hash ...
 type Hash[T item.Value, R item.Key, K Key] struct {
-	sess   memproxy.Session
-	getKey func(v T) K
+	sess    memproxy.Session
+	getKey  func(v T) K
+	codec   BucketCodec[T]
+	options Options
 
 	bucketItem *item.Item[Bucket[T], BucketKey[R]]
+
+	// snapshot, when set via WithSnapshotReader, is consulted by Get before
+	// falling back to the memcached pipeline.
+	snapshot *SnapshotReader[T, R]
+}
+
+// WithSnapshotReader attaches r as a warm cache backing for h: Get consults r
+// for each bucket it needs before falling back to the memcached pipeline.
+func (h *Hash[T, R, K]) WithSnapshotReader(r *SnapshotReader[T, R]) *Hash[T, R, K] {
+	h.snapshot = r
+	return h
 }
 
 // HashUpdater ...
 type HashUpdater[T item.Value, R item.Key, K Key] struct {
-	sess        memproxy.Session
-	getKey      func(v T) K
-	unmarshaler item.Unmarshaler[Bucket[T]]
-	filler      Filler[T, R]
+	sess    memproxy.Session
+	getKey  func(v T) K
+	codec   BucketCodec[T]
+	options Options
+	filler  Filler[T, R]
+	setter  Setter[R]
+}
+
+// NewUpdater creates a HashUpdater that reads buckets through filler and writes
+// them back through setter, both encoded with codec so that a Hash reading the
+// same trie with the same codec sees exactly what was written.
+func NewUpdater[T item.Value, R item.Key, K Key](
+	sess memproxy.Session,
+	getKey func(v T) K,
+	codec BucketCodec[T],
+	options Options,
+	filler Filler[T, R],
+	setter Setter[R],
+) *HashUpdater[T, R, K] {
+	return &HashUpdater[T, R, K]{
+		sess:    sess,
+		getKey:  getKey,
+		codec:   codec,
+		options: options.withDefaults(),
+		filler:  filler,
+		setter:  setter,
+	}
 }
 
 // New ...
@@ -81,7 +185,34 @@ func New[T item.Value, R item.Key, K Key](
 	unmarshaler item.Unmarshaler[T],
 	filler Filler[T, R],
 ) *Hash[T, R, K] {
-	bucketUnmarshaler := BucketUnmarshalerFromItem(unmarshaler)
+	return NewWithOptions[T, R, K](sess, pipeline, getKey, newItemBucketCodec[T](unmarshaler), Options{}, filler)
+}
+
+// NewWithCodec is like New but lets the caller choose the BucketCodec used to
+// encode and decode buckets, instead of deriving the default codec from an
+// item.Unmarshaler[T].
+func NewWithCodec[T item.Value, R item.Key, K Key](
+	sess memproxy.Session,
+	pipeline memproxy.Pipeline,
+	getKey func(v T) K,
+	codec BucketCodec[T],
+	filler Filler[T, R],
+) *Hash[T, R, K] {
+	return NewWithOptions[T, R, K](sess, pipeline, getKey, codec, Options{}, filler)
+}
+
+// NewWithOptions is like NewWithCodec but additionally lets the caller
+// configure the trie depth and fanout via Options. Zero-valued fields in
+// options fall back to the package defaults (MaxDepth 5, BitsPerLevel 8).
+func NewWithOptions[T item.Value, R item.Key, K Key](
+	sess memproxy.Session,
+	pipeline memproxy.Pipeline,
+	getKey func(v T) K,
+	codec BucketCodec[T],
+	options Options,
+	filler Filler[T, R],
+) *Hash[T, R, K] {
+	options = options.withDefaults()
 
 	var bucketFiller item.Filler[Bucket[T], BucketKey[R]] = func(
 		ctx context.Context, key BucketKey[R],
@@ -92,32 +223,81 @@ func New[T item.Value, R item.Key, K Key](
 			if err != nil {
 				return Bucket[T]{}, err
 			}
-			return bucketUnmarshaler(data)
+			return codec.UnmarshalBucket(data)
 		}
 	}
 
 	return &Hash[T, R, K]{
-		sess:   sess,
-		getKey: getKey,
+		sess:    sess,
+		getKey:  getKey,
+		codec:   codec,
+		options: options,
 
 		bucketItem: item.New[Bucket[T], BucketKey[R]](
-			sess, pipeline, bucketUnmarshaler, bucketFiller,
+			sess, pipeline, codec.UnmarshalBucket, bucketFiller,
 		),
 	}
 }
 
+// CodecName returns the name of the BucketCodec used to encode and decode
+// buckets, so metrics can label the encoding in use.
+func (h *Hash[T, R, K]) CodecName() string {
+	return h.codec.CodecName()
+}
+
 type getResult[T any] struct {
 	resp Null[T]
 	err  error
 }
 
-func computeHashAtLevel(hash uint64, hashLen int) uint64 {
-	return hash & (math.MaxUint64 << (64 - 8*hashLen))
+func computeHashAtLevel(hash uint64, hashLen int, bitsPerLevel int) uint64 {
+	bits := hashLen * bitsPerLevel
+	if bits >= 64 {
+		return hash
+	}
+	return hash & (math.MaxUint64 << (64 - bits))
 }
 
-func computeBitOffsetAtNextLevel(hash uint64, currentHashLen int) int {
-	offset := (hash >> (64 - 8 - currentHashLen*8)) & 0xff
-	return int(offset)
+func computeBitOffsetAtNextLevel(hash uint64, currentHashLen int, bitsPerLevel int) int {
+	shift := 64 - bitsPerLevel - currentHashLen*bitsPerLevel
+	mask := uint64(1<<bitsPerLevel) - 1
+	if shift < 0 {
+		// Past the 64-bit hash entirely; every remaining level maps to offset 0.
+		return 0
+	}
+	return int((hash >> shift) & mask)
+}
+
+// lookupStep is the outcome of inspecting a single bucket while descending the
+// trie for one key: either the key was found (or confirmed absent) in resp, a
+// terminal error occurred, or the walk must continue one level deeper.
+type lookupStep[T any] struct {
+	resp    Null[T]
+	err     error
+	descend bool
+}
+
+// lookupInBucket inspects bucket for key at the given hashLen, deciding whether
+// to resolve immediately or descend one more level. It is shared by Get and
+// GetMulti so both entry points apply the exact same per-level rules.
+func lookupInBucket[T item.Value, K Key](
+	bucket Bucket[T], getKey func(T) K, key K,
+	keyHash uint64, hashLen int, options Options,
+) lookupStep[T] {
+	bitOffset := computeBitOffsetAtNextLevel(keyHash, hashLen, options.BitsPerLevel)
+	if bucket.Bitset.GetBit(bitOffset) {
+		if hashLen+1 >= options.MaxDepth {
+			return lookupStep[T]{err: ErrHashTooDeep}
+		}
+		return lookupStep[T]{descend: true}
+	}
+
+	for _, bucketItem := range bucket.Items {
+		if getKey(bucketItem) == key {
+			return lookupStep[T]{resp: Null[T]{Valid: true, Data: bucketItem}}
+		}
+	}
+	return lookupStep[T]{}
 }
 
 // Get ...
@@ -129,11 +309,21 @@ func (h *Hash[T, R, K]) Get(ctx context.Context, rootKey R, key K) func() (Null[
 	hashLen := 0
 
 	doGetFn := func() {
-		rootBucketFn = h.bucketItem.Get(ctx, BucketKey[R]{
+		bucketKey := BucketKey[R]{
 			RootKey: rootKey,
-			Hash:    computeHashAtLevel(keyHash, hashLen),
+			Hash:    computeHashAtLevel(keyHash, hashLen, h.options.BitsPerLevel),
 			HashLen: hashLen,
-		})
+		}
+
+		if h.snapshot != nil {
+			if bucket, ok, err := h.snapshot.Get(bucketKey); ok || err != nil {
+				rootBucketFn = func() (Bucket[T], error) { return bucket, err }
+				h.sess.AddNextCall(nextCallFn)
+				return
+			}
+		}
+
+		rootBucketFn = h.bucketItem.Get(ctx, bucketKey)
 		h.sess.AddNextCall(nextCallFn)
 	}
 
@@ -145,27 +335,13 @@ func (h *Hash[T, R, K]) Get(ctx context.Context, rootKey R, key K) func() (Null[
 			return
 		}
 
-		bitOffset := computeBitOffsetAtNextLevel(keyHash, hashLen)
-		if bucket.Bitset.GetBit(bitOffset) {
+		step := lookupInBucket(bucket, h.getKey, key, keyHash, hashLen, h.options)
+		if step.descend {
 			hashLen++
-			if hashLen >= maxDeepLevels {
-				result.err = ErrHashTooDeep
-				return
-			}
 			doGetFn()
 			return
 		}
-
-		for _, bucketItem := range bucket.Items {
-			itemKey := h.getKey(bucketItem)
-			if itemKey == key {
-				result.resp = Null[T]{
-					Valid: true,
-					Data:  bucketItem,
-				}
-				return
-			}
-		}
+		result.resp, result.err = step.resp, step.err
 	}
 
 	doGetFn()
@@ -175,3 +351,9 @@ func (h *Hash[T, R, K]) Get(ctx context.Context, rootKey R, key K) func() (Null[
 		return result.resp, result.err
 	}
 }
+
+// CodecName returns the name of the BucketCodec used to encode and decode
+// buckets, so metrics can label the encoding in use.
+func (u *HashUpdater[T, R, K]) CodecName() string {
+	return u.codec.CodecName()
+}
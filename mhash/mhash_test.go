@@ -0,0 +1,140 @@
+package mhash
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestBitSet_GetSetBit(t *testing.T) {
+	bs := newBitSet(256)
+	if bs.GetBit(17) {
+		t.Fatalf("bit 17 should start unset")
+	}
+	bs.SetBit(17)
+	if !bs.GetBit(17) {
+		t.Errorf("bit 17 should be set")
+	}
+	if bs.GetBit(18) {
+		t.Errorf("bit 18 should remain unset")
+	}
+}
+
+func TestOptions_withDefaults(t *testing.T) {
+	tests := []struct {
+		name           string
+		in             Options
+		wantMaxDepth   int
+		wantBitsPerLvl int
+	}{
+		{
+			name:           "zero value uses package defaults",
+			in:             Options{},
+			wantMaxDepth:   defaultMaxDepth,
+			wantBitsPerLvl: defaultBitsPerLevel,
+		},
+		{
+			// MaxDepth=10 * BitsPerLevel=8 would need 80 bits, more than the 64-bit
+			// hash has; withDefaults must clamp MaxDepth instead of letting
+			// computeBitOffsetAtNextLevel be asked for a negative shift.
+			name:           "MaxDepth is clamped so MaxDepth*BitsPerLevel fits in 64 bits",
+			in:             Options{MaxDepth: 10, BitsPerLevel: 8},
+			wantMaxDepth:   8,
+			wantBitsPerLvl: 8,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got := tc.in.withDefaults()
+			if got.MaxDepth != tc.wantMaxDepth {
+				t.Errorf("MaxDepth = %d, want %d", got.MaxDepth, tc.wantMaxDepth)
+			}
+			if got.BitsPerLevel != tc.wantBitsPerLvl {
+				t.Errorf("BitsPerLevel = %d, want %d", got.BitsPerLevel, tc.wantBitsPerLvl)
+			}
+			if got.MaxDepth*got.BitsPerLevel > 64 {
+				t.Errorf("MaxDepth*BitsPerLevel = %d, want <= 64", got.MaxDepth*got.BitsPerLevel)
+			}
+		})
+	}
+}
+
+// TestComputeBitOffsetAtNextLevel_NoOverflowPastHashWidth pins down the bug
+// where Options{MaxDepth: 10} with the default BitsPerLevel of 8 used to panic
+// with a negative shift count once hashLen reached 8: the offset must instead
+// saturate at 0 once currentHashLen*bitsPerLevel already consumes the whole hash.
+func TestComputeBitOffsetAtNextLevel_NoOverflowPastHashWidth(t *testing.T) {
+	got := computeBitOffsetAtNextLevel(0xFFFFFFFFFFFFFFFF, 8, 8)
+	if got != 0 {
+		t.Errorf("computeBitOffsetAtNextLevel past hash width = %d, want 0", got)
+	}
+}
+
+func TestComputeHashAtLevel(t *testing.T) {
+	hash := uint64(0x0102030405060708)
+
+	if got := computeHashAtLevel(hash, 0, 8); got != 0 {
+		t.Errorf("computeHashAtLevel(level 0) = %x, want 0", got)
+	}
+	if got, want := computeHashAtLevel(hash, 1, 8), uint64(0x0100000000000000); got != want {
+		t.Errorf("computeHashAtLevel(level 1) = %x, want %x", got, want)
+	}
+	if got := computeHashAtLevel(hash, 8, 8); got != hash {
+		t.Errorf("computeHashAtLevel(full depth) = %x, want %x", got, hash)
+	}
+}
+
+type mhashTestKey uint64
+
+func (k mhashTestKey) Hash() uint64 {
+	return uint64(k)
+}
+
+// Marshal satisfies item.Value so mhashTestKey can stand in as both T and K
+// in lookupInBucket, mirroring how updaterTestItem/updaterTestKey split the
+// two roles elsewhere in this package's tests.
+func (k mhashTestKey) Marshal() ([]byte, error) {
+	return []byte(strconv.FormatUint(uint64(k), 10)), nil
+}
+
+func TestLookupInBucket(t *testing.T) {
+	options := Options{BitsPerLevel: 8, MaxDepth: 5}.withDefaults()
+	getKey := func(k mhashTestKey) mhashTestKey { return k }
+
+	present := mhashTestKey(123)
+	bucket := Bucket[mhashTestKey]{Items: []mhashTestKey{present}}
+
+	step := lookupInBucket(bucket, getKey, present, present.Hash(), 0, options)
+	if !step.resp.Valid || step.resp.Data != present {
+		t.Errorf("lookupInBucket(present) = %+v, want a valid match", step)
+	}
+
+	absent := mhashTestKey(456)
+	step = lookupInBucket(bucket, getKey, absent, absent.Hash(), 0, options)
+	if step.resp.Valid || step.descend || step.err != nil {
+		t.Errorf("lookupInBucket(absent) = %+v, want zero value", step)
+	}
+
+	splitBucket := Bucket[mhashTestKey]{Bitset: newBitSet(options.numBitsetEntries())}
+	bitOffset := computeBitOffsetAtNextLevel(absent.Hash(), 0, options.BitsPerLevel)
+	splitBucket.Bitset.SetBit(bitOffset)
+	step = lookupInBucket(splitBucket, getKey, absent, absent.Hash(), 0, options)
+	if !step.descend || step.err != nil {
+		t.Errorf("lookupInBucket(split) = %+v, want descend", step)
+	}
+}
+
+func TestMergeBucketItem(t *testing.T) {
+	items := []updaterTestItem{{K: 1, Data: "a"}, {K: 2, Data: "b"}}
+	getKey := func(v updaterTestItem) updaterTestKey { return v.K }
+
+	items = mergeBucketItem(items, getKey, updaterTestItem{K: 2, Data: "b2"})
+	if len(items) != 2 || items[1].Data != "b2" {
+		t.Errorf("mergeBucketItem(existing key) = %+v, want key 2 replaced in place", items)
+	}
+
+	items = mergeBucketItem(items, getKey, updaterTestItem{K: 3, Data: "c"})
+	if len(items) != 3 || items[2].Data != "c" {
+		t.Errorf("mergeBucketItem(new key) = %+v, want key 3 appended", items)
+	}
+}
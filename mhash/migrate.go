@@ -0,0 +1,30 @@
+package mhash
+
+import (
+	"context"
+
+	"github.com/QuangTung97/memproxy/item"
+)
+
+// MigrateOptions re-hashes every item reachable from rootKey in oldHash into a
+// tree built with a different Options value (most commonly a different
+// BitsPerLevel), by walking oldHash with Iterate and handing each item to
+// insert so the caller can re-derive its BucketKey under the new layout.
+func MigrateOptions[T item.Value, R item.Key, K Key](
+	ctx context.Context,
+	oldHash *Hash[T, R, K],
+	rootKey R,
+	insert func(ctx context.Context, val T) error,
+) error {
+	it := oldHash.Iterate(ctx, rootKey, IterateOptions{})
+	for {
+		val, ok := it.Next()
+		if !ok {
+			break
+		}
+		if err := insert(ctx, val); err != nil {
+			return err
+		}
+	}
+	return it.Err()
+}
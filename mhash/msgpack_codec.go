@@ -0,0 +1,67 @@
+package mhash
+
+import (
+	"github.com/QuangTung97/memproxy/item"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// MsgpackBucketCodec encodes buckets using MessagePack.
+type MsgpackBucketCodec[T item.Value] struct {
+	unmarshalItem item.Unmarshaler[T]
+}
+
+// NewMsgpackBucketCodec builds a BucketCodec that encodes buckets using MessagePack.
+func NewMsgpackBucketCodec[T item.Value](unmarshaler item.Unmarshaler[T]) BucketCodec[T] {
+	return MsgpackBucketCodec[T]{unmarshalItem: unmarshaler}
+}
+
+// msgpackBucket is the MessagePack wire shape for Bucket[T]: items are marshaled
+// individually beforehand, same as RLPBucketCodec, so T needs no msgpack tags.
+type msgpackBucket struct {
+	Items  [][]byte
+	Bitset []byte
+}
+
+// MarshalBucket encodes bucket as a MessagePack-packed list of marshaled items
+// plus the bitset.
+func (c MsgpackBucketCodec[T]) MarshalBucket(bucket Bucket[T]) ([]byte, error) {
+	raw := msgpackBucket{
+		Items:  make([][]byte, 0, len(bucket.Items)),
+		Bitset: bucket.Bitset[:],
+	}
+	for _, it := range bucket.Items {
+		data, err := it.Marshal()
+		if err != nil {
+			return nil, err
+		}
+		raw.Items = append(raw.Items, data)
+	}
+	return msgpack.Marshal(raw)
+}
+
+// UnmarshalBucket decodes bucket data previously produced by MarshalBucket.
+func (c MsgpackBucketCodec[T]) UnmarshalBucket(data []byte) (Bucket[T], error) {
+	var raw msgpackBucket
+	if err := msgpack.Unmarshal(data, &raw); err != nil {
+		return Bucket[T]{}, err
+	}
+
+	bucket := Bucket[T]{
+		Items:  make([]T, 0, len(raw.Items)),
+		Bitset: make(BitSet, len(raw.Bitset)),
+	}
+	for _, itemData := range raw.Items {
+		v, err := c.unmarshalItem(itemData)
+		if err != nil {
+			return Bucket[T]{}, err
+		}
+		bucket.Items = append(bucket.Items, v)
+	}
+	copy(bucket.Bitset, raw.Bitset)
+	return bucket, nil
+}
+
+// CodecName returns "msgpack".
+func (c MsgpackBucketCodec[T]) CodecName() string {
+	return "msgpack"
+}
@@ -0,0 +1,76 @@
+package mhash
+
+import (
+	"bytes"
+
+	"github.com/QuangTung97/memproxy/item"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// RLPBucketCodec encodes buckets using RLP, following the canonical ethereum
+// encoding rules: a nil Items slice round-trips as an empty list and BitSet
+// (a variable-length byte slice, sized by Options.BitsPerLevel) is carried as
+// a single byte string.
+type RLPBucketCodec[T item.Value] struct {
+	unmarshalItem item.Unmarshaler[T]
+}
+
+// NewRLPBucketCodec builds a BucketCodec that encodes buckets using RLP.
+func NewRLPBucketCodec[T item.Value](unmarshaler item.Unmarshaler[T]) BucketCodec[T] {
+	return RLPBucketCodec[T]{unmarshalItem: unmarshaler}
+}
+
+// rlpBucket is the RLP wire shape for Bucket[T]: items are marshaled individually
+// beforehand so the codec does not need RLP struct tags for an arbitrary T.
+type rlpBucket struct {
+	Items  [][]byte
+	Bitset []byte
+}
+
+// MarshalBucket encodes bucket as an RLP list of marshaled items plus the bitset.
+func (c RLPBucketCodec[T]) MarshalBucket(bucket Bucket[T]) ([]byte, error) {
+	raw := rlpBucket{
+		Items:  make([][]byte, 0, len(bucket.Items)),
+		Bitset: bucket.Bitset[:],
+	}
+	for _, it := range bucket.Items {
+		data, err := it.Marshal()
+		if err != nil {
+			return nil, err
+		}
+		raw.Items = append(raw.Items, data)
+	}
+
+	var buf bytes.Buffer
+	if err := rlp.Encode(&buf, raw); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// UnmarshalBucket decodes bucket data previously produced by MarshalBucket.
+func (c RLPBucketCodec[T]) UnmarshalBucket(data []byte) (Bucket[T], error) {
+	var raw rlpBucket
+	if err := rlp.DecodeBytes(data, &raw); err != nil {
+		return Bucket[T]{}, err
+	}
+
+	bucket := Bucket[T]{
+		Items:  make([]T, 0, len(raw.Items)),
+		Bitset: make(BitSet, len(raw.Bitset)),
+	}
+	for _, itemData := range raw.Items {
+		v, err := c.unmarshalItem(itemData)
+		if err != nil {
+			return Bucket[T]{}, err
+		}
+		bucket.Items = append(bucket.Items, v)
+	}
+	copy(bucket.Bitset, raw.Bitset)
+	return bucket, nil
+}
+
+// CodecName returns "rlp".
+func (c RLPBucketCodec[T]) CodecName() string {
+	return "rlp"
+}
@@ -0,0 +1,291 @@
+package mhash
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/QuangTung97/memproxy/item"
+	"golang.org/x/sync/errgroup"
+)
+
+// snapshotMagic identifies a sealed mhash snapshot file.
+const snapshotMagic uint32 = 0x6d686173 // "mhas"
+
+const snapshotVersion uint32 = 1
+
+// snapshotHeaderLen is the size in bytes of the fixed snapshot header.
+const snapshotHeaderLen = 4 + 4 + 8 + 4 // magic + version + file size + num buckets
+
+// bucketHdrLen is the size in bytes of a single entry in the bucket offset table:
+// the bucket's own (Hash, HashLen) so a reader can resolve a BucketKey without
+// depending on insertion order, plus its (offset, length) in the file.
+const bucketHdrLen = 8 + 1 + 8 + 4 // hash + hashLen + offset + length
+
+// SnapshotHeader is the fixed-size header stored at the beginning of a snapshot file.
+type SnapshotHeader struct {
+	Magic      uint32
+	Version    uint32
+	FileSize   uint64
+	NumBuckets uint32
+}
+
+func (h SnapshotHeader) encode() []byte {
+	data := make([]byte, snapshotHeaderLen)
+	binary.BigEndian.PutUint32(data[0:4], h.Magic)
+	binary.BigEndian.PutUint32(data[4:8], h.Version)
+	binary.BigEndian.PutUint64(data[8:16], h.FileSize)
+	binary.BigEndian.PutUint32(data[16:20], h.NumBuckets)
+	return data
+}
+
+func decodeSnapshotHeader(data []byte) (SnapshotHeader, error) {
+	if len(data) < snapshotHeaderLen {
+		return SnapshotHeader{}, fmt.Errorf("mhash: snapshot header too short")
+	}
+	h := SnapshotHeader{
+		Magic:      binary.BigEndian.Uint32(data[0:4]),
+		Version:    binary.BigEndian.Uint32(data[4:8]),
+		FileSize:   binary.BigEndian.Uint64(data[8:16]),
+		NumBuckets: binary.BigEndian.Uint32(data[16:20]),
+	}
+	if h.Magic != snapshotMagic {
+		return SnapshotHeader{}, fmt.Errorf("mhash: invalid snapshot magic: %x", h.Magic)
+	}
+	return h, nil
+}
+
+// snapshotEntry is a bucket staged by SnapshotBuilder.Insert, waiting to be sealed. hash
+// and hashLen are the bucket's own BucketKey.Hash/HashLen, carried through to
+// the offset table so a reader can resolve buckets without depending on the
+// (nondeterministic, since Insert may run concurrently) order entries were
+// staged in.
+type snapshotEntry struct {
+	hash    uint64
+	hashLen int
+	data    []byte
+}
+
+// SnapshotBuilder builds a memory-mappable snapshot index file out of the buckets of
+// a mhash trie, using a two-pass layout: buckets are sized and assigned offsets first,
+// then sealed into the destination file in parallel.
+type SnapshotBuilder[T item.Value, R item.Key] struct {
+	dir            string
+	numItems       uint
+	targetFileSize uint64
+
+	// Workers is the number of goroutines used by Seal to write buckets in parallel.
+	// NewSnapshotBuilder sets it to 4; Seal uses a single goroutine when it is
+	// zero or negative.
+	Workers int
+
+	mut     sync.Mutex
+	entries []snapshotEntry
+}
+
+// NewSnapshotBuilder creates a SnapshotBuilder for a tree expected to hold around numItems
+// items, targeting an output file of at least targetFileSize bytes. dir is stored on the
+// builder but not used: Seal writes only to the file it is given and creates no scratch files.
+func NewSnapshotBuilder[T item.Value, R item.Key](
+	dir string, numItems uint, targetFileSize uint64,
+) *SnapshotBuilder[T, R] {
+	return &SnapshotBuilder[T, R]{
+		dir:            dir,
+		numItems:       numItems,
+		targetFileSize: targetFileSize,
+		Workers:        4,
+	}
+}
+
+// Insert stages a bucket for writing into the snapshot. Safe to call concurrently;
+// the bucket's key is carried alongside its data so Seal does not depend on the
+// order Insert calls land in.
+func (b *SnapshotBuilder[T, R]) Insert(key BucketKey[R], bucket Bucket[T]) error {
+	data, err := marshalSnapshotBucket(bucket)
+	if err != nil {
+		return fmt.Errorf("mhash: marshal bucket for snapshot: %w", err)
+	}
+
+	b.mut.Lock()
+	b.entries = append(b.entries, snapshotEntry{
+		hash:    key.Hash,
+		hashLen: key.HashLen,
+		data:    data,
+	})
+	b.mut.Unlock()
+	return nil
+}
+
+// Seal writes the header, the bucket offset table, and every inserted bucket into f.
+// The file is pre-allocated to its final size up front, then buckets are sealed
+// concurrently using up to b.Workers goroutines.
+func (b *SnapshotBuilder[T, R]) Seal(ctx context.Context, f *os.File) error {
+	b.mut.Lock()
+	entries := b.entries
+	b.mut.Unlock()
+
+	offsets := make([]uint64, len(entries))
+	lengths := make([]uint32, len(entries))
+
+	offset := uint64(snapshotHeaderLen) + uint64(len(entries))*bucketHdrLen
+	for i, e := range entries {
+		offsets[i] = offset
+		lengths[i] = uint32(len(e.data))
+		offset += uint64(len(e.data))
+	}
+
+	fileSize := offset
+	if fileSize < b.targetFileSize {
+		fileSize = b.targetFileSize
+	}
+
+	if err := preallocateFile(f, fileSize); err != nil {
+		return fmt.Errorf("mhash: preallocate snapshot file: %w", err)
+	}
+
+	header := SnapshotHeader{
+		Magic:      snapshotMagic,
+		Version:    snapshotVersion,
+		FileSize:   fileSize,
+		NumBuckets: uint32(len(entries)),
+	}
+	if _, err := f.WriteAt(header.encode(), 0); err != nil {
+		return fmt.Errorf("mhash: write snapshot header: %w", err)
+	}
+
+	hdrTable := make([]byte, len(entries)*bucketHdrLen)
+	for i, e := range entries {
+		off := i * bucketHdrLen
+		binary.BigEndian.PutUint64(hdrTable[off:off+8], e.hash)
+		hdrTable[off+8] = byte(e.hashLen)
+		binary.BigEndian.PutUint64(hdrTable[off+9:off+17], offsets[i])
+		binary.BigEndian.PutUint32(hdrTable[off+17:off+21], lengths[i])
+	}
+	if _, err := f.WriteAt(hdrTable, snapshotHeaderLen); err != nil {
+		return fmt.Errorf("mhash: write snapshot offset table: %w", err)
+	}
+
+	workers := b.Workers
+	if workers <= 0 {
+		workers = 1
+	}
+
+	g, _ := errgroup.WithContext(ctx)
+	g.SetLimit(workers)
+
+	for i := range entries {
+		i := i
+		g.Go(func() error {
+			_, err := f.WriteAt(entries[i].data, int64(offsets[i]))
+			return err
+		})
+	}
+	return g.Wait()
+}
+
+// snapshotBucketKey identifies a bucket within a single snapshot file by its
+// own (Hash, HashLen), deliberately omitting BucketKey.RootKey: a SnapshotBuilder seals
+// the trie of exactly one RootKey, so every bucket in the file shares it.
+type snapshotBucketKey struct {
+	hash    uint64
+	hashLen int
+}
+
+// SnapshotReader resolves bucket keys against a sealed snapshot file in O(1) using the
+// bucket offset table written by SnapshotBuilder.Seal, so that Hash.Get can consult it as a warm
+// cache backing before falling back to the memcached pipeline. The index is built
+// entirely from the (Hash, HashLen) stored in the file's own offset table, so it
+// does not depend on SnapshotBuilder.Insert's (possibly concurrent, unordered) call order.
+type SnapshotReader[T item.Value, R item.Key] struct {
+	f      *os.File
+	header SnapshotHeader
+
+	unmarshal func([]byte) (Bucket[T], error)
+
+	offsets []uint64
+	lengths []uint32
+	index   map[snapshotBucketKey]int
+}
+
+// NewSnapshotReader opens and validates a snapshot file previously produced by
+// SnapshotBuilder.Seal, and builds an in-memory index resolving bucket keys to their offsets.
+func NewSnapshotReader[T item.Value, R item.Key](
+	f *os.File, unmarshaler item.Unmarshaler[T],
+) (*SnapshotReader[T, R], error) {
+	hdrData := make([]byte, snapshotHeaderLen)
+	if _, err := f.ReadAt(hdrData, 0); err != nil {
+		return nil, fmt.Errorf("mhash: read snapshot header: %w", err)
+	}
+	header, err := decodeSnapshotHeader(hdrData)
+	if err != nil {
+		return nil, err
+	}
+
+	hdrTable := make([]byte, int(header.NumBuckets)*bucketHdrLen)
+	if _, err := f.ReadAt(hdrTable, snapshotHeaderLen); err != nil {
+		return nil, fmt.Errorf("mhash: read snapshot offset table: %w", err)
+	}
+
+	offsets := make([]uint64, header.NumBuckets)
+	lengths := make([]uint32, header.NumBuckets)
+	index := make(map[snapshotBucketKey]int, header.NumBuckets)
+	for i := range offsets {
+		off := i * bucketHdrLen
+		hash := binary.BigEndian.Uint64(hdrTable[off : off+8])
+		hashLen := int(hdrTable[off+8])
+		offsets[i] = binary.BigEndian.Uint64(hdrTable[off+9 : off+17])
+		lengths[i] = binary.BigEndian.Uint32(hdrTable[off+17 : off+21])
+		index[snapshotBucketKey{hash: hash, hashLen: hashLen}] = i
+	}
+
+	return &SnapshotReader[T, R]{
+		f:         f,
+		header:    header,
+		unmarshal: BucketUnmarshalerFromItem(unmarshaler),
+		offsets:   offsets,
+		lengths:   lengths,
+		index:     index,
+	}, nil
+}
+
+// Get resolves key against the snapshot, reporting ok=false when key is not present.
+func (r *SnapshotReader[T, R]) Get(key BucketKey[R]) (bucket Bucket[T], ok bool, err error) {
+	idx, found := r.index[snapshotBucketKey{hash: key.Hash, hashLen: key.HashLen}]
+	if !found {
+		return Bucket[T]{}, false, nil
+	}
+
+	data := make([]byte, r.lengths[idx])
+	if _, err := r.f.ReadAt(data, int64(r.offsets[idx])); err != nil {
+		return Bucket[T]{}, false, fmt.Errorf("mhash: read snapshot bucket: %w", err)
+	}
+
+	bucket, err = r.unmarshal(data)
+	if err != nil {
+		return Bucket[T]{}, false, fmt.Errorf("mhash: unmarshal snapshot bucket: %w", err)
+	}
+	return bucket, true, nil
+}
+
+func marshalSnapshotBucket[T item.Value](bucket Bucket[T]) ([]byte, error) {
+	buf := make([]byte, 0, 64+len(bucket.Items)*32)
+
+	var lenBuf [4]byte
+	binary.BigEndian.PutUint32(lenBuf[:], uint32(len(bucket.Items)))
+	buf = append(buf, lenBuf[:]...)
+
+	for _, it := range bucket.Items {
+		data, err := it.Marshal()
+		if err != nil {
+			return nil, err
+		}
+		binary.BigEndian.PutUint32(lenBuf[:], uint32(len(data)))
+		buf = append(buf, lenBuf[:]...)
+		buf = append(buf, data...)
+	}
+
+	buf = append(buf, bucket.Bitset[:]...)
+	return buf, nil
+}
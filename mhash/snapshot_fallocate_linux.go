@@ -0,0 +1,19 @@
+//go:build linux
+
+package mhash
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// preallocateFile reserves size bytes for f using fallocate, falling back to
+// Truncate when the underlying filesystem does not support it.
+func preallocateFile(f *os.File, size uint64) error {
+	err := unix.Fallocate(int(f.Fd()), 0, 0, int64(size))
+	if err != nil {
+		return f.Truncate(int64(size))
+	}
+	return nil
+}
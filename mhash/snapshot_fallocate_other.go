@@ -0,0 +1,11 @@
+//go:build !linux
+
+package mhash
+
+import "os"
+
+// preallocateFile reserves size bytes for f. fallocate is Linux-specific, so on
+// other platforms this simply truncates the file to its final size.
+func preallocateFile(f *os.File, size uint64) error {
+	return f.Truncate(int64(size))
+}
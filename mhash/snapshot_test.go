@@ -0,0 +1,72 @@
+package mhash
+
+import (
+	"context"
+	"os"
+	"reflect"
+	"testing"
+)
+
+type snapshotTestRootKey string
+
+func (k snapshotTestRootKey) String() string {
+	return string(k)
+}
+
+// TestSnapshotBuilderReader_RoundTrip checks that a bucket Inserted into a
+// SnapshotBuilder and Sealed to a file is returned unchanged by
+// SnapshotReader.Get, keyed by the bucket's own (Hash, HashLen) rather than
+// by the order Insert was called in.
+func TestSnapshotBuilderReader_RoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	builder := NewSnapshotBuilder[codecTestItem, snapshotTestRootKey](dir, 2, 0)
+
+	keys := []BucketKey[snapshotTestRootKey]{
+		{RootKey: "root", Hash: 0, HashLen: 0},
+		{RootKey: "root", Hash: 1 << 56, HashLen: 1},
+	}
+	buckets := []Bucket[codecTestItem]{
+		{Items: []codecTestItem{{Key: "a", Data: "1"}}, Bitset: newBitSet(256)},
+		{Items: []codecTestItem{{Key: "b", Data: "2"}}, Bitset: newBitSet(256)},
+	}
+	// Insert in reverse order: SnapshotReader must resolve buckets by their
+	// own key, not by the position they were staged in.
+	for i := len(keys) - 1; i >= 0; i-- {
+		if err := builder.Insert(keys[i], buckets[i]); err != nil {
+			t.Fatalf("Insert(%d): %v", i, err)
+		}
+	}
+
+	f, err := os.CreateTemp(dir, "snapshot-*.bin")
+	if err != nil {
+		t.Fatalf("CreateTemp: %v", err)
+	}
+	defer f.Close()
+
+	if err := builder.Seal(context.Background(), f); err != nil {
+		t.Fatalf("Seal: %v", err)
+	}
+
+	reader, err := NewSnapshotReader[codecTestItem, snapshotTestRootKey](f, unmarshalCodecTestItem)
+	if err != nil {
+		t.Fatalf("NewSnapshotReader: %v", err)
+	}
+
+	for i, key := range keys {
+		bucket, ok, err := reader.Get(key)
+		if err != nil {
+			t.Fatalf("Get(%d): %v", i, err)
+		}
+		if !ok {
+			t.Fatalf("Get(%d): not found", i)
+		}
+		if !reflect.DeepEqual(bucket.Items, buckets[i].Items) {
+			t.Errorf("Get(%d) items = %+v, want %+v", i, bucket.Items, buckets[i].Items)
+		}
+	}
+
+	missing := BucketKey[snapshotTestRootKey]{RootKey: "root", Hash: 2 << 56, HashLen: 1}
+	if _, ok, err := reader.Get(missing); err != nil || ok {
+		t.Errorf("Get(missing) = ok:%v err:%v, want ok:false err:nil", ok, err)
+	}
+}
@@ -0,0 +1,190 @@
+package mhash
+
+import (
+	"context"
+	"sort"
+
+	"github.com/QuangTung97/memproxy/item"
+)
+
+// mergeBucketItem inserts value into items, replacing any existing entry with
+// the same key.
+func mergeBucketItem[T item.Value, K Key](items []T, getKey func(T) K, value T) []T {
+	key := getKey(value)
+	for i, it := range items {
+		if getKey(it) == key {
+			items[i] = value
+			return items
+		}
+	}
+	return append(items, value)
+}
+
+// Set inserts or replaces value under rootKey: it walks the trie exactly like
+// Hash.Get to find the bucket value belongs in, merges value into that
+// bucket's Items, and writes the result back through the same BucketCodec
+// used for reads, so the write round-trips with whatever Hash reads it back.
+// When Options.AdaptiveSplit is enabled and the merged bucket grows past
+// Options.MaxBucketItems, the bucket is split into a child trie level instead
+// of being written back in place, unless hashLen is already at the MaxDepth
+// wall, in which case it is written back oversized rather than split into a
+// level nothing could read back (see shouldWriteSplit and writeSplitBucket).
+func (u *HashUpdater[T, R, K]) Set(ctx context.Context, rootKey R, value T) func() error {
+	keyHash := u.getKey(value).Hash()
+
+	var resultErr error
+	hashLen := 0
+
+	var stepFn func()
+	var fetchFn func() ([]byte, error)
+
+	doFetchFn := func() {
+		hash := computeHashAtLevel(keyHash, hashLen, u.options.BitsPerLevel)
+		fetchFn = u.filler(ctx, rootKey, hash)
+		u.sess.AddNextCall(stepFn)
+	}
+
+	stepFn = func() {
+		data, err := fetchFn()
+		if err != nil {
+			resultErr = err
+			return
+		}
+
+		bucket, err := u.codec.UnmarshalBucket(data)
+		if err != nil {
+			resultErr = err
+			return
+		}
+
+		bitOffset := computeBitOffsetAtNextLevel(keyHash, hashLen, u.options.BitsPerLevel)
+		if bucket.Bitset.GetBit(bitOffset) {
+			hashLen++
+			if hashLen >= u.options.MaxDepth {
+				resultErr = ErrHashTooDeep
+				return
+			}
+			doFetchFn()
+			return
+		}
+
+		bucket.Items = mergeBucketItem(bucket.Items, u.getKey, value)
+		hash := computeHashAtLevel(keyHash, hashLen, u.options.BitsPerLevel)
+
+		var writeFn func() error
+		if u.shouldWriteSplit(bucket, hashLen) {
+			writeFn = u.writeSplitBucket(ctx, rootKey, hashLen, hash, bucket)
+		} else {
+			writeFn = u.writeBucket(ctx, rootKey, hash, bucket)
+		}
+		u.sess.AddNextCall(func() {
+			resultErr = writeFn()
+		})
+	}
+
+	doFetchFn()
+
+	return func() error {
+		u.sess.Execute()
+		return resultErr
+	}
+}
+
+// writeBucket encodes bucket with u.codec and hands it to u.setter.
+func (u *HashUpdater[T, R, K]) writeBucket(
+	ctx context.Context, rootKey R, hash uint64, bucket Bucket[T],
+) func() error {
+	data, err := u.codec.MarshalBucket(bucket)
+	if err != nil {
+		return func() error { return err }
+	}
+	return u.setter(ctx, rootKey, hash, data)
+}
+
+// shouldWriteSplit reports whether Set should write bucket as a split rather
+// than in place: splitting is only safe when there is still a level left
+// below hashLen, i.e. the same hashLen+1 >= MaxDepth wall the read path in
+// Set already stops descending at. A bucket that hits MaxBucketItems right
+// at that wall is written in place, oversized, rather than split into
+// children one level past MaxDepth that nothing could ever read back.
+func (u *HashUpdater[T, R, K]) shouldWriteSplit(bucket Bucket[T], hashLen int) bool {
+	return u.ShouldSplit(bucket) && hashLen+1 < u.options.MaxDepth
+}
+
+// writeSplitBucket replaces an over-full bucket in place: every item is
+// regrouped by the bit offset it would occupy one level deeper, each group is
+// written as its own child bucket, and the parent is rewritten empty with the
+// Bitset bits for those offsets set, so Get/Iterate descend into the children
+// instead of finding items directly in the parent.
+func (u *HashUpdater[T, R, K]) writeSplitBucket(
+	ctx context.Context, rootKey R, hashLen int, hash uint64, bucket Bucket[T],
+) func() error {
+	bitsPerLevel := u.options.BitsPerLevel
+
+	groups := make(map[int][]T)
+	for _, it := range bucket.Items {
+		offset := computeBitOffsetAtNextLevel(u.getKey(it).Hash(), hashLen, bitsPerLevel)
+		groups[offset] = append(groups[offset], it)
+	}
+
+	offsets := make([]int, 0, len(groups))
+	for offset := range groups {
+		offsets = append(offsets, offset)
+	}
+	sort.Ints(offsets)
+
+	parent := Bucket[T]{Bitset: newBitSet(u.options.numBitsetEntries())}
+	for _, offset := range offsets {
+		parent.Bitset.SetBit(offset)
+	}
+	parentWriteFn := u.writeBucket(ctx, rootKey, hash, parent)
+
+	childShift := 64 - bitsPerLevel - hashLen*bitsPerLevel
+	childWriteFns := make([]func() error, 0, len(offsets))
+	for _, offset := range offsets {
+		childHash := hash | (uint64(offset) << childShift)
+		childWriteFns = append(
+			childWriteFns,
+			u.writeBucket(ctx, rootKey, childHash, Bucket[T]{Items: groups[offset]}),
+		)
+	}
+
+	return func() error {
+		if err := parentWriteFn(); err != nil {
+			return err
+		}
+		for _, fn := range childWriteFns {
+			if err := fn(); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// Compact merges the sibling buckets in children (keyed by their offset under
+// parentHash) back into a single bucket at parentHash, when
+// IsSparse reports their combined item count fits back under
+// Options.MaxBucketItems. It is meant to be driven by a background compaction
+// loop rather than the request path; on a non-sparse set of children it is a
+// no-op that returns nil without writing anything.
+func (u *HashUpdater[T, R, K]) Compact(
+	ctx context.Context, rootKey R, parentHash uint64, children map[int]Bucket[T],
+) func() error {
+	counts := make([]int, 0, len(children))
+	merged := make([]T, 0)
+	for _, child := range children {
+		counts = append(counts, len(child.Items))
+		merged = append(merged, child.Items...)
+	}
+
+	if !u.IsSparse(counts) {
+		return func() error { return nil }
+	}
+
+	parent := Bucket[T]{
+		Items:  merged,
+		Bitset: newBitSet(u.options.numBitsetEntries()),
+	}
+	return u.writeBucket(ctx, rootKey, parentHash, parent)
+}
@@ -0,0 +1,280 @@
+package mhash
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+type updaterTestRootKey string
+
+func (k updaterTestRootKey) String() string {
+	return string(k)
+}
+
+type updaterTestKey uint64
+
+func (k updaterTestKey) Hash() uint64 {
+	return uint64(k)
+}
+
+type updaterTestItem struct {
+	K    updaterTestKey
+	Data string
+}
+
+func (v updaterTestItem) Marshal() ([]byte, error) {
+	return []byte(strconv.FormatUint(uint64(v.K), 10) + "|" + v.Data), nil
+}
+
+func unmarshalUpdaterTestItem(data []byte) (updaterTestItem, error) {
+	key, rest, _ := strings.Cut(string(data), "|")
+	n, err := strconv.ParseUint(key, 10, 64)
+	if err != nil {
+		return updaterTestItem{}, err
+	}
+	return updaterTestItem{K: updaterTestKey(n), Data: rest}, nil
+}
+
+// recordedWrite is one call a fake Setter received, in call order.
+type recordedWrite struct {
+	hash uint64
+	data []byte
+}
+
+// fakeSession is a minimal memproxy.Session double covering the only two
+// methods mhash ever calls on a Session: AddNextCall queues a callback and
+// Execute drains the queue, including callbacks newly queued by callbacks
+// that ran before them (the same pattern Get/GetMulti/Set/Iterate all rely
+// on for multi-level descent).
+type fakeSession struct {
+	calls []func()
+}
+
+func (s *fakeSession) AddNextCall(fn func()) {
+	s.calls = append(s.calls, fn)
+}
+
+func (s *fakeSession) Execute() {
+	for len(s.calls) > 0 {
+		fn := s.calls[0]
+		s.calls = s.calls[1:]
+		fn()
+	}
+}
+
+// newTestUpdater builds a HashUpdater around a recording Setter; writeSplitBucket
+// and Compact never touch sess or filler, so both are left nil here.
+func newTestUpdater(
+	options Options, writes *[]recordedWrite,
+) *HashUpdater[updaterTestItem, updaterTestRootKey, updaterTestKey] {
+	setter := func(_ context.Context, _ updaterTestRootKey, hash uint64, data []byte) func() error {
+		*writes = append(*writes, recordedWrite{hash: hash, data: data})
+		return func() error { return nil }
+	}
+
+	return NewUpdater[updaterTestItem, updaterTestRootKey, updaterTestKey](
+		nil,
+		func(v updaterTestItem) updaterTestKey { return v.K },
+		newItemBucketCodec[updaterTestItem](unmarshalUpdaterTestItem),
+		options,
+		nil,
+		setter,
+	)
+}
+
+// newTestUpdaterWithFiller builds a HashUpdater backed by a real fakeSession
+// and a Filler that always returns existing's encoding, so Set can be driven
+// end to end (including the MaxDepth boundary check in shouldWriteSplit)
+// without a real memproxy.Session/item.Item.
+func newTestUpdaterWithFiller(
+	options Options, existing Bucket[updaterTestItem], writes *[]recordedWrite,
+) *HashUpdater[updaterTestItem, updaterTestRootKey, updaterTestKey] {
+	codec := newItemBucketCodec[updaterTestItem](unmarshalUpdaterTestItem)
+	existingData, err := codec.MarshalBucket(existing)
+	if err != nil {
+		panic(err)
+	}
+
+	filler := func(_ context.Context, _ updaterTestRootKey, _ uint64) func() ([]byte, error) {
+		return func() ([]byte, error) { return existingData, nil }
+	}
+	setter := func(_ context.Context, _ updaterTestRootKey, hash uint64, data []byte) func() error {
+		*writes = append(*writes, recordedWrite{hash: hash, data: data})
+		return func() error { return nil }
+	}
+
+	return NewUpdater[updaterTestItem, updaterTestRootKey, updaterTestKey](
+		&fakeSession{},
+		func(v updaterTestItem) updaterTestKey { return v.K },
+		codec,
+		options,
+		filler,
+		setter,
+	)
+}
+
+// TestHashUpdater_Set_SplitAtMaxDepthWall exercises the boundary writeSplitBucket
+// was missing a guard for: merging a value into the bucket at the deepest
+// reachable level must write the oversized bucket back in place instead of
+// splitting into a child level past MaxDepth that nothing could ever read.
+func TestHashUpdater_Set_SplitAtMaxDepthWall(t *testing.T) {
+	existing := Bucket[updaterTestItem]{
+		Items: []updaterTestItem{{K: updaterTestKey(1 << 56), Data: "existing"}},
+	}
+	newValue := updaterTestItem{K: updaterTestKey(2 << 56), Data: "new"}
+
+	t.Run("writes in place at the MaxDepth wall instead of splitting", func(t *testing.T) {
+		var writes []recordedWrite
+		u := newTestUpdaterWithFiller(
+			Options{AdaptiveSplit: true, MaxBucketItems: 1, MaxDepth: 1, BitsPerLevel: 8},
+			existing, &writes,
+		)
+
+		if err := u.Set(context.Background(), "root", newValue)(); err != nil {
+			t.Fatalf("Set() = %v, want nil", err)
+		}
+
+		if len(writes) != 1 {
+			t.Fatalf("got %d writes, want 1 (written in place, not split)", len(writes))
+		}
+		if writes[0].hash != 0 {
+			t.Errorf("write hash = %d, want 0 (root level, in place)", writes[0].hash)
+		}
+		bucket, err := u.codec.UnmarshalBucket(writes[0].data)
+		if err != nil {
+			t.Fatalf("unmarshal: %v", err)
+		}
+		if len(bucket.Items) != 2 {
+			t.Errorf("bucket items = %+v, want both items written back together", bucket.Items)
+		}
+	})
+
+	t.Run("splits normally when a level remains under MaxDepth", func(t *testing.T) {
+		var writes []recordedWrite
+		u := newTestUpdaterWithFiller(
+			Options{AdaptiveSplit: true, MaxBucketItems: 1, MaxDepth: 2, BitsPerLevel: 8},
+			existing, &writes,
+		)
+
+		if err := u.Set(context.Background(), "root", newValue)(); err != nil {
+			t.Fatalf("Set() = %v, want nil", err)
+		}
+
+		if len(writes) != 3 {
+			t.Fatalf("got %d writes, want 3 (1 parent + 2 children)", len(writes))
+		}
+		if writes[0].hash != 0 {
+			t.Errorf("parent hash = %d, want 0", writes[0].hash)
+		}
+		parent, err := u.codec.UnmarshalBucket(writes[0].data)
+		if err != nil {
+			t.Fatalf("unmarshal parent: %v", err)
+		}
+		if len(parent.Items) != 0 {
+			t.Errorf("parent items = %+v, want empty (split into children)", parent.Items)
+		}
+	})
+}
+
+// TestHashUpdater_writeSplitBucket checks that splitting a bucket writes back
+// an empty parent with the right Bitset bits set, plus one child bucket per
+// group of items, instead of growing the parent bucket in place.
+func TestHashUpdater_writeSplitBucket(t *testing.T) {
+	var writes []recordedWrite
+	u := newTestUpdater(Options{AdaptiveSplit: true, MaxBucketItems: 1, BitsPerLevel: 8}, &writes)
+
+	itemA := updaterTestItem{K: updaterTestKey(1 << 56), Data: "a"}
+	itemB := updaterTestItem{K: updaterTestKey(2 << 56), Data: "b"}
+
+	writeFn := u.writeSplitBucket(context.Background(), "root", 0, 0, Bucket[updaterTestItem]{
+		Items: []updaterTestItem{itemA, itemB},
+	})
+
+	if len(writes) != 3 {
+		t.Fatalf("got %d writes, want 3 (1 parent + 2 children)", len(writes))
+	}
+
+	parentBucket, err := u.codec.UnmarshalBucket(writes[0].data)
+	if err != nil {
+		t.Fatalf("unmarshal parent: %v", err)
+	}
+	if writes[0].hash != 0 {
+		t.Errorf("parent hash = %d, want 0", writes[0].hash)
+	}
+	if len(parentBucket.Items) != 0 {
+		t.Errorf("parent items = %+v, want empty", parentBucket.Items)
+	}
+	if !parentBucket.Bitset.GetBit(1) || !parentBucket.Bitset.GetBit(2) {
+		t.Errorf("parent bitset missing bits 1 and 2: %x", parentBucket.Bitset)
+	}
+
+	wantChildHash := map[uint64]updaterTestItem{
+		uint64(1) << 56: itemA,
+		uint64(2) << 56: itemB,
+	}
+	for _, w := range writes[1:] {
+		want, ok := wantChildHash[w.hash]
+		if !ok {
+			t.Fatalf("unexpected child hash %d", w.hash)
+		}
+		childBucket, err := u.codec.UnmarshalBucket(w.data)
+		if err != nil {
+			t.Fatalf("unmarshal child %d: %v", w.hash, err)
+		}
+		if len(childBucket.Items) != 1 || childBucket.Items[0] != want {
+			t.Errorf("child %d items = %+v, want [%+v]", w.hash, childBucket.Items, want)
+		}
+	}
+
+	if err := writeFn(); err != nil {
+		t.Errorf("writeFn() = %v, want nil", err)
+	}
+}
+
+// TestHashUpdater_Compact checks that sparse sibling buckets are merged back
+// into their parent, and that a non-sparse set of siblings is left untouched.
+func TestHashUpdater_Compact(t *testing.T) {
+	children := map[int]Bucket[updaterTestItem]{
+		1: {Items: []updaterTestItem{{K: 1, Data: "a"}}},
+		2: {Items: []updaterTestItem{{K: 2, Data: "b"}}},
+	}
+
+	t.Run("sparse merges into parent", func(t *testing.T) {
+		var writes []recordedWrite
+		u := newTestUpdater(Options{AdaptiveSplit: true, MaxBucketItems: 10}, &writes)
+
+		writeFn := u.Compact(context.Background(), "root", 42, children)
+		if err := writeFn(); err != nil {
+			t.Fatalf("writeFn() = %v, want nil", err)
+		}
+
+		if len(writes) != 1 {
+			t.Fatalf("got %d writes, want 1", len(writes))
+		}
+		if writes[0].hash != 42 {
+			t.Errorf("write hash = %d, want 42", writes[0].hash)
+		}
+		merged, err := u.codec.UnmarshalBucket(writes[0].data)
+		if err != nil {
+			t.Fatalf("unmarshal merged: %v", err)
+		}
+		if len(merged.Items) != 2 {
+			t.Errorf("merged items = %+v, want 2 items", merged.Items)
+		}
+	})
+
+	t.Run("not sparse is a no-op", func(t *testing.T) {
+		var writes []recordedWrite
+		u := newTestUpdater(Options{AdaptiveSplit: true, MaxBucketItems: 1}, &writes)
+
+		writeFn := u.Compact(context.Background(), "root", 42, children)
+		if err := writeFn(); err != nil {
+			t.Fatalf("writeFn() = %v, want nil", err)
+		}
+		if len(writes) != 0 {
+			t.Fatalf("got %d writes, want 0", len(writes))
+		}
+	})
+}